@@ -0,0 +1,115 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Level
+	}{
+		{"error", ErrorLevel},
+		{"WARN", WarnLevel},
+		{"Info", InfoLevel},
+		{"debug", DebugLevel},
+		{"none", NoneLevel},
+		{"bogus", InfoLevel},
+		{"", InfoLevel},
+	}
+	for _, tc := range cases {
+		if got := ParseLevel(tc.in); got != tc.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func withSink(t *testing.T, f Format) (*bytes.Buffer, func()) {
+	mu.Lock()
+	prevSink, prevOut := sink, out
+	var buf bytes.Buffer
+	sink, out = f, &buf
+	mu.Unlock()
+	return &buf, func() {
+		mu.Lock()
+		sink, out = prevSink, prevOut
+		mu.Unlock()
+	}
+}
+
+func TestScopeLevelGating(t *testing.T) {
+	buf, restore := withSink(t, TextFormat)
+	defer restore()
+
+	s := &Scope{name: "gating-test", level: WarnLevel}
+	s.Infof("should not appear")
+	if buf.Len() != 0 {
+		t.Errorf("Infof() at WarnLevel wrote output: %q, want nothing", buf.String())
+	}
+	s.Warnf("should appear")
+	if !strings.Contains(buf.String(), "should appear") {
+		t.Errorf("Warnf() at WarnLevel = %q, want it to contain the message", buf.String())
+	}
+}
+
+func TestScopeTextFormat(t *testing.T) {
+	buf, restore := withSink(t, TextFormat)
+	defer restore()
+
+	s := &Scope{name: "text-test", level: InfoLevel}
+	s.Infof("hello %s", "world")
+
+	line := strings.TrimRight(buf.String(), "\n")
+	parts := strings.Split(line, "\t")
+	if len(parts) < 3 || parts[0] != "text-test" || parts[1] != "INFO" || parts[2] != "hello world" {
+		t.Errorf("TextFormat output = %q, want \"text-test\\tINFO\\thello world\"", line)
+	}
+}
+
+func TestScopeJSONFormat(t *testing.T) {
+	buf, restore := withSink(t, JSONFormat)
+	defer restore()
+
+	s := &Scope{name: "json-test", level: InfoLevel}
+	s.WithFields(Fields{"namespace": "default"}).Infof("hello %s", "world")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("JSONFormat output is not valid JSON: %s (%q)", err, buf.String())
+	}
+	if entry["scope"] != "json-test" || entry["level"] != "info" || entry["msg"] != "hello world" || entry["namespace"] != "default" {
+		t.Errorf("JSONFormat entry = %v, want scope/level/msg/namespace to be set", entry)
+	}
+}
+
+func TestRegisterScopeIsIdempotent(t *testing.T) {
+	s1 := RegisterScope("idempotent-test")
+	s1.SetOutputLevel(DebugLevel)
+	s2 := RegisterScope("idempotent-test")
+	if s1 != s2 {
+		t.Fatal("RegisterScope() returned a different *Scope on the second call for the same name")
+	}
+	if s2.OutputLevel() != DebugLevel {
+		t.Errorf("OutputLevel() = %v, want the level set via the first registration to stick", s2.OutputLevel())
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package multicluster watches remote-cluster kubeconfig Secrets and
+// maintains a live registry of kubernetes.Interface clients, one per
+// member cluster of a multi-cluster Istio mesh. It follows the secret
+// controller pattern used by Admiral.
+package multicluster
+
+import (
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/aspenmesh/istio-vet/pkg/log"
+)
+
+var scope = log.RegisterScope("mesh")
+
+const (
+	// ClusterSecretNamespace is the Namespace watched for remote cluster
+	// kubeconfig Secrets.
+	ClusterSecretNamespace = "istio-system"
+
+	// ClusterSecretLabel marks a Secret as carrying one or more remote
+	// clusters' kubeconfigs, one cluster name per data key.
+	ClusterSecretLabel = "istio/multiCluster"
+
+	// PrimaryCluster names the cluster istio-vet itself is running
+	// against, as opposed to a remote cluster discovered via a
+	// ClusterSecretLabel Secret.
+	PrimaryCluster = "primary"
+)
+
+// ClusterScoped tags a value with the name of the cluster it was retrieved
+// from, so that names which collide across clusters can still be told
+// apart. Value holds the wrapped object (e.g. a corev1.Namespace), typed
+// per-slice so callers don't need to type-assert it back out.
+type ClusterScoped[T any] struct {
+	Cluster string
+	Value   T
+}
+
+// AddHandler is invoked when a new remote cluster is discovered.
+type AddHandler func(cluster string, client kubernetes.Interface)
+
+// UpdateHandler is invoked when a remote cluster's kubeconfig changes.
+type UpdateHandler func(cluster string, client kubernetes.Interface)
+
+// DeleteHandler is invoked when a remote cluster's Secret is removed.
+type DeleteHandler func(cluster string)
+
+// Controller watches Secret objects labeled "istio/multiCluster=true" in
+// ClusterSecretNamespace, parses each data entry as a kubeconfig, and
+// maintains a live map of remote kubernetes.Interface clients keyed by
+// cluster name.
+type Controller struct {
+	mu      sync.RWMutex
+	clients map[string]kubernetes.Interface
+
+	informer cache.SharedIndexInformer
+
+	addHandlers    []AddHandler
+	updateHandlers []UpdateHandler
+	deleteHandlers []DeleteHandler
+}
+
+// NewController returns a Controller that watches remote-cluster kubeconfig
+// Secrets using client, the kubernetes.Interface for the primary cluster.
+func NewController(client kubernetes.Interface) *Controller {
+	c := &Controller{
+		clients: make(map[string]kubernetes.Interface),
+	}
+
+	listWatch := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = ClusterSecretLabel + "=true"
+			return client.CoreV1().Secrets(ClusterSecretNamespace).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = ClusterSecretLabel + "=true"
+			return client.CoreV1().Secrets(ClusterSecretNamespace).Watch(opts)
+		},
+	}
+
+	c.informer = cache.NewSharedIndexInformer(listWatch, &corev1.Secret{}, 0, cache.Indexers{})
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onAdd,
+		UpdateFunc: c.onUpdate,
+		DeleteFunc: c.onDelete,
+	})
+
+	return c
+}
+
+// Run starts the underlying Secret informer and blocks until stopCh is
+// closed.
+func (c *Controller) Run(stopCh <-chan struct{}) {
+	c.informer.Run(stopCh)
+}
+
+// HasSynced reports whether the initial list of remote-cluster Secrets has
+// been processed.
+func (c *Controller) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// AddAddHandler registers a callback invoked whenever a remote cluster is
+// added.
+func (c *Controller) AddAddHandler(h AddHandler) {
+	c.addHandlers = append(c.addHandlers, h)
+}
+
+// AddUpdateHandler registers a callback invoked whenever a remote
+// cluster's kubeconfig changes.
+func (c *Controller) AddUpdateHandler(h UpdateHandler) {
+	c.updateHandlers = append(c.updateHandlers, h)
+}
+
+// AddDeleteHandler registers a callback invoked whenever a remote cluster
+// is removed.
+func (c *Controller) AddDeleteHandler(h DeleteHandler) {
+	c.deleteHandlers = append(c.deleteHandlers, h)
+}
+
+// Clusters returns a snapshot of the currently known remote cluster clients
+// keyed by cluster name.
+func (c *Controller) Clusters() map[string]kubernetes.Interface {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[string]kubernetes.Interface, len(c.clients))
+	for k, v := range c.clients {
+		out[k] = v
+	}
+	return out
+}
+
+func (c *Controller) onAdd(obj interface{}) {
+	c.syncSecret(obj)
+}
+
+func (c *Controller) onUpdate(oldObj, newObj interface{}) {
+	c.syncSecret(newObj)
+}
+
+func (c *Controller) onDelete(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			scope.Errorf("Failed to decode cluster secret: %v", obj)
+			return
+		}
+		secret, ok = tombstone.Obj.(*corev1.Secret)
+		if !ok {
+			scope.Errorf("Failed to decode cluster secret from tombstone: %v", obj)
+			return
+		}
+	}
+	for cluster := range secret.Data {
+		c.mu.Lock()
+		delete(c.clients, cluster)
+		c.mu.Unlock()
+		for _, h := range c.deleteHandlers {
+			h(cluster)
+		}
+	}
+}
+
+func (c *Controller) syncSecret(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		scope.Errorf("Failed to decode cluster secret: %v", obj)
+		return
+	}
+	for cluster, kubeconfig := range secret.Data {
+		client, err := buildClient(kubeconfig)
+		if err != nil {
+			scope.WithFields(log.Fields{"cluster": cluster}).Errorf("Failed to build client: %s", err)
+			continue
+		}
+
+		c.mu.Lock()
+		_, existed := c.clients[cluster]
+		c.clients[cluster] = client
+		c.mu.Unlock()
+
+		if existed {
+			for _, h := range c.updateHandlers {
+				h(cluster, client)
+			}
+		} else {
+			for _, h := range c.addHandlers {
+				h(cluster, client)
+			}
+		}
+	}
+}
+
+func buildClient(kubeconfig []byte) (kubernetes.Interface, error) {
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %s", err)
+	}
+	return kubernetes.NewForConfig(config)
+}
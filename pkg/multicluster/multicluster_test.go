@@ -0,0 +1,138 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const fakeKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: https://remote.example.com
+contexts:
+- name: remote
+  context:
+    cluster: remote
+users: []
+current-context: remote
+`
+
+func clusterSecret(cluster string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster,
+			Namespace: ClusterSecretNamespace,
+			Labels:    map[string]string{ClusterSecretLabel: "true"},
+		},
+		Data: map[string][]byte{cluster: []byte(fakeKubeconfig)},
+	}
+}
+
+func TestControllerDiscoversClusterFromSecret(t *testing.T) {
+	client := fake.NewSimpleClientset(clusterSecret("remote-a"))
+	c := NewController(client)
+
+	var added []string
+	c.AddAddHandler(func(cluster string, _ kubernetes.Interface) {
+		added = append(added, cluster)
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go c.Run(stopCh)
+
+	if !waitForSynced(c) {
+		t.Fatal("Controller did not sync within the deadline")
+	}
+
+	clusters := c.Clusters()
+	if _, ok := clusters["remote-a"]; !ok {
+		t.Errorf("Clusters() = %v, want it to contain \"remote-a\"", clusters)
+	}
+	if !existsInStringSlice("remote-a", added) {
+		t.Errorf("AddHandler was not invoked for \"remote-a\"")
+	}
+}
+
+func TestControllerForgetsClusterOnSecretDelete(t *testing.T) {
+	secret := clusterSecret("remote-b")
+	client := fake.NewSimpleClientset(secret)
+	c := NewController(client)
+
+	var deleted []string
+	c.AddDeleteHandler(func(cluster string) {
+		deleted = append(deleted, cluster)
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go c.Run(stopCh)
+
+	if !waitForSynced(c) {
+		t.Fatal("Controller did not sync within the deadline")
+	}
+
+	if err := client.CoreV1().Secrets(ClusterSecretNamespace).Delete(secret.Name, &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete cluster secret: %s", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := c.Clusters()["remote-b"]; !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, ok := c.Clusters()["remote-b"]; ok {
+		t.Error("Clusters() still contains \"remote-b\" after its Secret was deleted")
+	}
+	if !existsInStringSlice("remote-b", deleted) {
+		t.Errorf("DeleteHandler was not invoked for \"remote-b\"")
+	}
+}
+
+func waitForSynced(c *Controller) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if c.HasSynced() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func existsInStringSlice(e string, list []string) bool {
+	for i := range list {
+		if e == list[i] {
+			return true
+		}
+	}
+	return false
+}
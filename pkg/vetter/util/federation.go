@@ -0,0 +1,188 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	apiv1 "github.com/aspenmesh/istio-vet/api/v1"
+	"github.com/aspenmesh/istio-vet/pkg/log"
+)
+
+const (
+	// FederationConfigMap stores the list of FederationPeer this mesh is
+	// federated with, in IstioNamespace.
+	FederationConfigMap = "istio-federation"
+	// FederationConfigMapKey is the data key holding the YAML-encoded
+	// []FederationPeer.
+	FederationConfigMapKey = "peers"
+
+	federation_disabled_summary = "Istio mesh federation is not configured." +
+		" Create the \"" + FederationConfigMap + "\" configmap in the \"" + IstioNamespace +
+		"\" namespace with a list of FederationPeer to use "
+)
+
+// ErrFederationDisabled is the sentinel error returned by GetFederationPeers
+// when the istio-federation configmap does not exist, i.e. this mesh is not
+// federated with any peer.
+var ErrFederationDisabled = errors.New("mesh federation is not configured")
+
+// DefaultServiceExportGVR and DefaultServiceImportGVR are the
+// GroupVersionResource of the ServiceExport/ServiceImport style CRs used by
+// the Kubernetes multicluster-services (MCS) API. Callers targeting a
+// different federation implementation's CRD schema can supply their own
+// GVR to ListExportedServicesInMesh/ListImportedServicesInMesh instead.
+var (
+	DefaultServiceExportGVR = schema.GroupVersionResource{
+		Group: "multicluster.x-k8s.io", Version: "v1alpha1", Resource: "serviceexports"}
+	DefaultServiceImportGVR = schema.GroupVersionResource{
+		Group: "multicluster.x-k8s.io", Version: "v1alpha1", Resource: "serviceimports"}
+)
+
+// FederationPeer describes a remote mesh this mesh is federated with.
+type FederationPeer struct {
+	Name           string `json:"name"`
+	TrustDomain    string `json:"trustDomain"`
+	RemoteEndpoint string `json:"remoteEndpoint"`
+}
+
+// GetFederationPeers retrieves the FederationPeer list configured for this
+// mesh. The list is stored as the FederationConfigMapKey key of the
+// FederationConfigMap configmap in IstioNamespace. Returns
+// ErrFederationDisabled if the configmap does not exist.
+func GetFederationPeers(c kubernetes.Interface) ([]FederationPeer, error) {
+	cm, err := c.CoreV1().ConfigMaps(IstioNamespace).Get(FederationConfigMap, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			scopeMesh.Debugf("Federation configmap: %s not found in namespace: %s", FederationConfigMap, IstioNamespace)
+			return nil, ErrFederationDisabled
+		}
+		scopeMesh.Errorf("Failed to retrieve configmap: %s error: %s", FederationConfigMap, err)
+		return nil, err
+	}
+	d, ok := cm.Data[FederationConfigMapKey]
+	if !ok {
+		scopeMesh.Errorf("Missing configuration map key: %s in configmap: %s", FederationConfigMapKey, FederationConfigMap)
+		return nil, fmt.Errorf("missing configuration map key: %s in configmap: %s", FederationConfigMapKey, FederationConfigMap)
+	}
+	var peers []FederationPeer
+	if err := yaml.Unmarshal([]byte(d), &peers); err != nil {
+		scopeMesh.Errorf("Failed to parse yaml federation peers config: %s", err)
+		return nil, err
+	}
+	return peers, nil
+}
+
+// FederationDisabledNote generates an INFO note if err is
+// ErrFederationDisabled, i.e. this mesh has no istio-federation configmap
+// configuring any FederationPeer.
+func FederationDisabledNote(err error, vetterId, vetterType string) *apiv1.Note {
+	if err == ErrFederationDisabled {
+		return &apiv1.Note{
+			Type:    vetterType,
+			Summary: federation_disabled_summary + "\"" + vetterId + "\" vetter.",
+			Level:   apiv1.NoteLevel_INFO}
+	}
+	return nil
+}
+
+// ListExportedServicesInMesh returns the Services in the mesh that carry a
+// matching ServiceExport custom resource, i.e. Services this mesh makes
+// available to its FederationPeers. The ServiceExport CRD's
+// GroupVersionResource is configurable via exportGVR so callers aren't
+// locked to the MCS API's schema.
+func ListExportedServicesInMesh(dc dynamic.Interface, c kubernetes.Interface, exportGVR schema.GroupVersionResource) ([]corev1.Service, error) {
+	svcs, err := ListServicesInMesh(c, nil, schema.GroupVersionResource{})
+	if err != nil {
+		return nil, err
+	}
+	exported := []corev1.Service{}
+	for _, s := range svcs {
+		if _, err := dc.Resource(exportGVR).Namespace(s.Namespace).Get(s.Name, metav1.GetOptions{}); err != nil {
+			continue
+		}
+		exported = append(exported, s)
+	}
+	return exported, nil
+}
+
+// ListImportedServicesInMesh returns a corev1.Service for every
+// ServiceImport custom resource found in a mesh Namespace, i.e. Services
+// federated in from a remote mesh that have no local backing workload. The
+// ServiceImport CRD's GroupVersionResource is configurable via importGVR so
+// callers aren't locked to the MCS API's schema.
+func ListImportedServicesInMesh(dc dynamic.Interface, c kubernetes.Interface, importGVR schema.GroupVersionResource) ([]corev1.Service, error) {
+	ns, err := ListNamespacesInMesh(c, dc, importGVR)
+	if err != nil {
+		return nil, err
+	}
+	imported := []corev1.Service{}
+	for _, n := range ns {
+		list, err := dc.Resource(importGVR).Namespace(n.Name).List(metav1.ListOptions{})
+		if err != nil {
+			scopeMesh.WithFields(log.Fields{"namespace": n.Name}).Debugf("Failed to list ServiceImports: %s", err)
+			continue
+		}
+		for _, item := range list.Items {
+			imported = append(imported, serviceImportToService(item))
+		}
+	}
+	return imported, nil
+}
+
+// serviceImportToService translates a ServiceImport unstructured object's
+// "spec.ports" into the equivalent corev1.Service so imported Services can
+// be handled identically to locally-backed ones.
+func serviceImportToService(u unstructured.Unstructured) corev1.Service {
+	svc := corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: u.GetName(), Namespace: u.GetNamespace()},
+	}
+	ports, _, _ := unstructured.NestedSlice(u.Object, "spec", "ports")
+	for _, p := range ports {
+		pm, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(pm, "name")
+		port, _, _ := unstructured.NestedInt64(pm, "port")
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: name, Port: int32(port)})
+	}
+	return svc
+}
+
+// FederatedServicePortsValid reports whether every port of a federated
+// Service (either side of a federation link -- exported or imported) is
+// named with an Istio-supported protocol prefix, see ServicePortPrefixed.
+func FederatedServicePortsValid(s corev1.Service) bool {
+	for _, p := range s.Spec.Ports {
+		if !ServicePortPrefixed(p.Name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func federationConfigMap(peersYAML string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: FederationConfigMap, Namespace: IstioNamespace},
+		Data:       map[string]string{FederationConfigMapKey: peersYAML},
+	}
+}
+
+func serviceImport(namespace, name string, ports ...corev1.ServicePort) *unstructured.Unstructured {
+	portList := make([]interface{}, len(ports))
+	for i, p := range ports {
+		portList[i] = map[string]interface{}{"name": p.Name, "port": int64(p.Port)}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": DefaultServiceImportGVR.GroupVersion().String(),
+		"kind":       "ServiceImport",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       map[string]interface{}{"ports": portList},
+	}}
+}
+
+func fakeDynamicClient(objs ...runtime.Object) dynamic.Interface {
+	scheme := runtime.NewScheme()
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		DefaultServiceImportGVR: "ServiceImportList",
+	}, objs...)
+}
+
+func TestListNamespacesInMeshIncludesFederatedOnlyNamespace(t *testing.T) {
+	c := kubefake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: IstioInitializerConfigMap, Namespace: IstioNamespace},
+			Data:       map[string]string{IstioInitializerConfigMapKey: "policy: enabled"},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "istio-system"}},
+	)
+	dc := fakeDynamicClient(serviceImport("istio-system", "remote-svc"))
+
+	ns, err := ListNamespacesInMesh(c, dc, DefaultServiceImportGVR)
+	if err != nil {
+		t.Fatalf("ListNamespacesInMesh() error = %s", err)
+	}
+	var names []string
+	for _, n := range ns {
+		names = append(names, n.Name)
+	}
+	if !existsInStringSlice("default", names) {
+		t.Errorf("ListNamespacesInMesh() = %v, want it to include the in-mesh namespace \"default\"", names)
+	}
+	if !existsInStringSlice("istio-system", names) {
+		t.Errorf("ListNamespacesInMesh() = %v, want it to include \"istio-system\" since it hosts a ServiceImport", names)
+	}
+}
+
+func TestListNamespacesInMeshWithoutDynamicClientSkipsFederation(t *testing.T) {
+	c := kubefake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: IstioInitializerConfigMap, Namespace: IstioNamespace},
+			Data:       map[string]string{IstioInitializerConfigMapKey: "policy: enabled"},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "istio-system"}},
+	)
+
+	ns, err := ListNamespacesInMesh(c, nil, schema.GroupVersionResource{})
+	if err != nil {
+		t.Fatalf("ListNamespacesInMesh() error = %s", err)
+	}
+	for _, n := range ns {
+		if n.Name == "istio-system" {
+			t.Errorf("ListNamespacesInMesh() with a nil dynamic.Interface = %v, want the exempted \"istio-system\" namespace excluded", n.Name)
+		}
+	}
+}
+
+func TestGetFederationPeers(t *testing.T) {
+	c := kubefake.NewSimpleClientset(federationConfigMap(`
+- name: peer-a
+  trustDomain: peer-a.example.com
+  remoteEndpoint: peer-a.example.com:15443
+`))
+
+	peers, err := GetFederationPeers(c)
+	if err != nil {
+		t.Fatalf("GetFederationPeers() error = %s", err)
+	}
+	if len(peers) != 1 || peers[0].Name != "peer-a" {
+		t.Errorf("GetFederationPeers() = %v, want a single peer named \"peer-a\"", peers)
+	}
+}
+
+func TestGetFederationPeersReturnsErrFederationDisabledWhenConfigMapMissing(t *testing.T) {
+	c := kubefake.NewSimpleClientset()
+
+	if _, err := GetFederationPeers(c); err != ErrFederationDisabled {
+		t.Errorf("GetFederationPeers() error = %v, want ErrFederationDisabled", err)
+	}
+}
+
+func TestListExportedServicesInMesh(t *testing.T) {
+	c := kubefake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: IstioInitializerConfigMap, Namespace: IstioNamespace},
+			Data:       map[string]string{IstioInitializerConfigMapKey: "policy: enabled"},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "exported-svc", Namespace: "default"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "local-only-svc", Namespace: "default"}},
+	)
+	exportScheme := runtime.NewScheme()
+	exportDc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(exportScheme, map[schema.GroupVersionResource]string{
+		DefaultServiceExportGVR: "ServiceExportList",
+	}, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": DefaultServiceExportGVR.GroupVersion().String(),
+		"kind":       "ServiceExport",
+		"metadata":   map[string]interface{}{"name": "exported-svc", "namespace": "default"},
+	}})
+
+	exported, err := ListExportedServicesInMesh(exportDc, c, DefaultServiceExportGVR)
+	if err != nil {
+		t.Fatalf("ListExportedServicesInMesh() error = %s", err)
+	}
+	var names []string
+	for _, s := range exported {
+		names = append(names, s.Name)
+	}
+	if !existsInStringSlice("exported-svc", names) {
+		t.Errorf("ListExportedServicesInMesh() = %v, want it to include \"exported-svc\"", names)
+	}
+	if existsInStringSlice("local-only-svc", names) {
+		t.Errorf("ListExportedServicesInMesh() = %v, want it to exclude \"local-only-svc\" which has no ServiceExport", names)
+	}
+}
+
+func TestListImportedServicesInMesh(t *testing.T) {
+	c := kubefake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: IstioInitializerConfigMap, Namespace: IstioNamespace},
+			Data:       map[string]string{IstioInitializerConfigMapKey: "policy: enabled"},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+	)
+	dc := fakeDynamicClient(serviceImport("default", "imported-svc",
+		corev1.ServicePort{Name: "http", Port: 8080}))
+
+	imported, err := ListImportedServicesInMesh(dc, c, DefaultServiceImportGVR)
+	if err != nil {
+		t.Fatalf("ListImportedServicesInMesh() error = %s", err)
+	}
+	if len(imported) != 1 || imported[0].Name != "imported-svc" {
+		t.Fatalf("ListImportedServicesInMesh() = %v, want a single Service named \"imported-svc\"", imported)
+	}
+	if len(imported[0].Spec.Ports) != 1 || imported[0].Spec.Ports[0].Port != 8080 {
+		t.Errorf("ListImportedServicesInMesh() port = %v, want port 8080", imported[0].Spec.Ports)
+	}
+}
+
+func TestServiceImportToServicePortCast(t *testing.T) {
+	u := serviceImport("default", "imported-svc", corev1.ServicePort{Name: "grpc", Port: 9090})
+
+	svc := serviceImportToService(*u)
+
+	if svc.Name != "imported-svc" || svc.Namespace != "default" {
+		t.Errorf("serviceImportToService() = %+v, want name/namespace \"imported-svc\"/\"default\"", svc.ObjectMeta)
+	}
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Name != "grpc" || svc.Spec.Ports[0].Port != int32(9090) {
+		t.Errorf("serviceImportToService() ports = %v, want a single int32 port 9090 named \"grpc\"", svc.Spec.Ports)
+	}
+}
+
+func TestFederatedServicePortsValid(t *testing.T) {
+	valid := corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http"}, {Name: "grpc-web"}}}}
+	if !FederatedServicePortsValid(valid) {
+		t.Error("FederatedServicePortsValid() = false for Istio-supported prefixed ports, want true")
+	}
+
+	invalid := corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http"}, {Name: "custom"}}}}
+	if FederatedServicePortsValid(invalid) {
+		t.Error("FederatedServicePortsValid() = true with an unprefixed port, want false")
+	}
+}
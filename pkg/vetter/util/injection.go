@@ -0,0 +1,180 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	admissionv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aspenmesh/istio-vet/pkg/log"
+)
+
+var scopeInject = log.RegisterScope("inject")
+
+const (
+	// IstioSidecarInjectorWebhook is the name of the MutatingWebhookConfiguration
+	// registered by modern Istio releases to perform automatic sidecar
+	// injection.
+	IstioSidecarInjectorWebhook = "istio-sidecar-injector"
+
+	// IstioSidecarInjectPodAnnotation lets a Pod opt in/out of webhook based
+	// sidecar injection, overriding the Namespace's namespaceSelector match.
+	IstioSidecarInjectPodAnnotation = "sidecar.istio.io/inject"
+)
+
+// InjectionSourceKind identifies which mechanism an InjectionSource
+// implements.
+type InjectionSourceKind int
+
+const (
+	// InjectionSourceInitializer is the deprecated Istio Initializer based
+	// injection mechanism.
+	InjectionSourceInitializer InjectionSourceKind = iota
+	// InjectionSourceWebhook is the MutatingWebhookConfiguration based
+	// injection mechanism used by modern Istio releases.
+	InjectionSourceWebhook
+)
+
+// InjectionSource abstracts over the mechanism used to automatically inject
+// the Istio sidecar, so that vetters don't need to know whether the cluster
+// is using the deprecated Initializer or a MutatingWebhookConfiguration.
+type InjectionSource interface {
+	// Kind identifies which mechanism this InjectionSource implements.
+	Kind() InjectionSourceKind
+	// NamespaceInjected reports whether the given Namespace is subject to
+	// automatic sidecar injection.
+	NamespaceInjected(n corev1.Namespace) bool
+	// PodInjected reports whether the given Pod should be treated as having
+	// sidecar injection enabled. nsInjected is the result of
+	// NamespaceInjected for p's Namespace; implementations must honor any
+	// per-Pod annotation override even when nsInjected is false, so the
+	// decision cannot be gated on the Pod's Namespace already having been
+	// selected as in-mesh.
+	PodInjected(p corev1.Pod, nsInjected bool) bool
+}
+
+// InitializerSource implements InjectionSource using the deprecated Istio
+// Initializer (istio-inject) configmap.
+type InitializerSource struct {
+	cfg *IstioInjectConfig
+}
+
+// Kind implements InjectionSource.
+func (s *InitializerSource) Kind() InjectionSourceKind {
+	return InjectionSourceInitializer
+}
+
+// NamespaceInjected implements InjectionSource.
+func (s *InitializerSource) NamespaceInjected(n corev1.Namespace) bool {
+	if ExemptedNamespace(n.Name) {
+		return false
+	}
+	if len(s.cfg.ExcludeNamespaces) > 0 && existsInStringSlice(n.Name, s.cfg.ExcludeNamespaces) {
+		return false
+	}
+	if len(s.cfg.IncludeNamespaces) > 0 {
+		return existsInStringSlice(corev1.NamespaceAll, s.cfg.IncludeNamespaces) ||
+			existsInStringSlice(n.Name, s.cfg.IncludeNamespaces)
+	}
+	return true
+}
+
+// PodInjected implements InjectionSource. The Initializer mechanism has no
+// per-Pod override, so the Pod is injected only if its Namespace is.
+func (s *InitializerSource) PodInjected(p corev1.Pod, nsInjected bool) bool {
+	return nsInjected && SidecarInjected(p)
+}
+
+// WebhookSource implements InjectionSource using a MutatingWebhookConfiguration
+// and the sidecar.istio.io/inject Pod annotation override.
+type WebhookSource struct {
+	webhook *admissionv1beta1.MutatingWebhookConfiguration
+}
+
+// Kind implements InjectionSource.
+func (s *WebhookSource) Kind() InjectionSourceKind {
+	return InjectionSourceWebhook
+}
+
+// NamespaceInjected implements InjectionSource. A Namespace is injected if
+// its labels match the namespaceSelector of any webhook in the
+// MutatingWebhookConfiguration, e.g. the common "istio-injection: enabled"
+// convention.
+func (s *WebhookSource) NamespaceInjected(n corev1.Namespace) bool {
+	if ExemptedNamespace(n.Name) {
+		return false
+	}
+	for _, wh := range s.webhook.Webhooks {
+		if wh.NamespaceSelector == nil {
+			continue
+		}
+		sel, err := metav1.LabelSelectorAsSelector(wh.NamespaceSelector)
+		if err != nil {
+			scopeInject.WithFields(log.Fields{"webhook": wh.Name}).Errorf("Failed to parse namespaceSelector: %s", err)
+			continue
+		}
+		if sel.Matches(labels.Set(n.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// PodInjected implements InjectionSource. The sidecar.istio.io/inject
+// annotation, when present, overrides nsInjected (the Namespace's
+// namespaceSelector match) in either direction -- including turning
+// injection on for a Pod in a Namespace the namespaceSelector does not
+// itself match.
+func (s *WebhookSource) PodInjected(p corev1.Pod, nsInjected bool) bool {
+	if v, ok := p.Annotations[IstioSidecarInjectPodAnnotation]; ok {
+		if v == "false" {
+			return false
+		}
+		if v == "true" {
+			return SidecarInjected(p)
+		}
+	}
+	return nsInjected && SidecarInjected(p)
+}
+
+// GetInjectionConfig auto-detects which sidecar injection mechanism is
+// active in the cluster and returns the corresponding InjectionSource. A
+// registered IstioSidecarInjectorWebhook MutatingWebhookConfiguration takes
+// precedence; if none is found it falls back to the deprecated Initializer
+// configmap so callers no longer need to know which mechanism is in play.
+func GetInjectionConfig(c kubernetes.Interface) (InjectionSource, error) {
+	wh, err := c.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get(IstioSidecarInjectorWebhook, metav1.GetOptions{})
+	if err == nil {
+		return &WebhookSource{webhook: wh}, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		scopeInject.Errorf("Failed to retrieve MutatingWebhookConfiguration: %s error: %s", IstioSidecarInjectorWebhook, err)
+		return nil, err
+	}
+	scopeInject.Debugf("MutatingWebhookConfiguration: %s not found, falling back to Initializer", IstioSidecarInjectorWebhook)
+
+	cfg, err := GetInitializerConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return &InitializerSource{cfg: cfg}, nil
+}
@@ -0,0 +1,125 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestWebhookSourceNamespaceInjected(t *testing.T) {
+	wh := &WebhookSource{webhook: &admissionv1beta1.MutatingWebhookConfiguration{
+		Webhooks: []admissionv1beta1.Webhook{{
+			Name: "sidecar-injector.istio.io",
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"istio-injection": "enabled"},
+			},
+		}},
+	}}
+
+	cases := []struct {
+		name string
+		ns   corev1.Namespace
+		want bool
+	}{
+		{"matching label", corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: "app", Labels: map[string]string{"istio-injection": "enabled"}}}, true},
+		{"non-matching label", corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: "app", Labels: map[string]string{"istio-injection": "disabled"}}}, false},
+		{"no labels", corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app"}}, false},
+		{"exempted namespace", corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: "istio-system", Labels: map[string]string{"istio-injection": "enabled"}}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := wh.NamespaceInjected(tc.ns); got != tc.want {
+				t.Errorf("NamespaceInjected(%s) = %v, want %v", tc.name, got, tc.want)
+			}
+		})
+	}
+}
+
+func injectedPod(annotation string, hasProxy bool) corev1.Pod {
+	p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	if annotation != "" {
+		p.Annotations[IstioSidecarInjectPodAnnotation] = annotation
+	}
+	p.Annotations[IstioInitializerPodAnnotation] = "injected-version-info"
+	if hasProxy {
+		p.Spec.Containers = []corev1.Container{{Name: IstioProxyContainerName}}
+	}
+	return p
+}
+
+func TestWebhookSourcePodInjected(t *testing.T) {
+	wh := &WebhookSource{}
+
+	cases := []struct {
+		name       string
+		pod        corev1.Pod
+		nsInjected bool
+		want       bool
+	}{
+		{"true override wins over non-matching namespace", injectedPod("true", true), false, true},
+		{"false override wins over matching namespace", injectedPod("false", true), true, false},
+		{"no override, namespace matches, proxy present", injectedPod("", true), true, true},
+		{"no override, namespace matches, no proxy", injectedPod("", false), true, false},
+		{"no override, namespace doesn't match", injectedPod("", true), false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := wh.PodInjected(tc.pod, tc.nsInjected); got != tc.want {
+				t.Errorf("PodInjected(%s) = %v, want %v", tc.name, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInitializerSourcePodInjected(t *testing.T) {
+	s := &InitializerSource{cfg: &IstioInjectConfig{}}
+	pod := injectedPod("", true)
+
+	if got := s.PodInjected(pod, false); got != false {
+		t.Errorf("PodInjected with nsInjected=false = %v, want false (no per-Pod override exists)", got)
+	}
+	if got := s.PodInjected(pod, true); got != true {
+		t.Errorf("PodInjected with nsInjected=true = %v, want true", got)
+	}
+}
+
+func TestGetInjectionConfigPropagatesNonNotFoundWebhookError(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	client.PrependReactor("get", "mutatingwebhookconfigurations", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{}, IstioSidecarInjectorWebhook, errors.New("rbac"))
+	})
+
+	if _, err := GetInjectionConfig(client); err == nil {
+		t.Fatal("GetInjectionConfig() = nil error, want the RBAC-forbidden error to be propagated")
+	} else if err == ErrInjectionDisabled {
+		t.Fatal("GetInjectionConfig() incorrectly reported ErrInjectionDisabled for a non-NotFound webhook error")
+	}
+}
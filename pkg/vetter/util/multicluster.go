@@ -0,0 +1,132 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aspenmesh/istio-vet/pkg/log"
+	"github.com/aspenmesh/istio-vet/pkg/multicluster"
+)
+
+var scopeMesh = log.RegisterScope("mesh")
+
+// ListNamespacesInMeshAll returns the Namespaces in the mesh across the
+// primary cluster (client c) and every remote cluster known to mc, each
+// wrapped in a multicluster.ClusterScoped tagging its origin cluster.
+// Federation is not evaluated per-cluster here since remote clusters are
+// not currently associated with their own dynamic.Interface; callers
+// needing federated Namespaces should call ListNamespacesInMesh directly.
+func ListNamespacesInMeshAll(c kubernetes.Interface, mc *multicluster.Controller) ([]multicluster.ClusterScoped[corev1.Namespace], error) {
+	out := []multicluster.ClusterScoped[corev1.Namespace]{}
+	ns, err := ListNamespacesInMesh(c, nil, schema.GroupVersionResource{})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range ns {
+		out = append(out, multicluster.ClusterScoped[corev1.Namespace]{Cluster: multicluster.PrimaryCluster, Value: n})
+	}
+	for cluster, client := range mc.Clusters() {
+		ns, err := ListNamespacesInMesh(client, nil, schema.GroupVersionResource{})
+		if err != nil {
+			scopeMesh.WithFields(log.Fields{"cluster": cluster}).Errorf("Failed to list namespaces: %s", err)
+			continue
+		}
+		for _, n := range ns {
+			out = append(out, multicluster.ClusterScoped[corev1.Namespace]{Cluster: cluster, Value: n})
+		}
+	}
+	return out, nil
+}
+
+// ListPodsInMeshAll returns the Pods in the mesh across the primary cluster
+// (client c) and every remote cluster known to mc, each wrapped in a
+// multicluster.ClusterScoped tagging its origin cluster.
+func ListPodsInMeshAll(c kubernetes.Interface, mc *multicluster.Controller) ([]multicluster.ClusterScoped[corev1.Pod], error) {
+	out := []multicluster.ClusterScoped[corev1.Pod]{}
+	pods, err := ListPodsInMesh(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pods {
+		out = append(out, multicluster.ClusterScoped[corev1.Pod]{Cluster: multicluster.PrimaryCluster, Value: p})
+	}
+	for cluster, client := range mc.Clusters() {
+		pods, err := ListPodsInMesh(client)
+		if err != nil {
+			scopeMesh.WithFields(log.Fields{"cluster": cluster}).Errorf("Failed to list pods: %s", err)
+			continue
+		}
+		for _, p := range pods {
+			out = append(out, multicluster.ClusterScoped[corev1.Pod]{Cluster: cluster, Value: p})
+		}
+	}
+	return out, nil
+}
+
+// ListServicesInMeshAll returns the Services in the mesh across the primary
+// cluster (client c) and every remote cluster known to mc, each wrapped in a
+// multicluster.ClusterScoped tagging its origin cluster.
+func ListServicesInMeshAll(c kubernetes.Interface, mc *multicluster.Controller) ([]multicluster.ClusterScoped[corev1.Service], error) {
+	out := []multicluster.ClusterScoped[corev1.Service]{}
+	svcs, err := ListServicesInMesh(c, nil, schema.GroupVersionResource{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range svcs {
+		out = append(out, multicluster.ClusterScoped[corev1.Service]{Cluster: multicluster.PrimaryCluster, Value: s})
+	}
+	for cluster, client := range mc.Clusters() {
+		svcs, err := ListServicesInMesh(client, nil, schema.GroupVersionResource{})
+		if err != nil {
+			scopeMesh.WithFields(log.Fields{"cluster": cluster}).Errorf("Failed to list services: %s", err)
+			continue
+		}
+		for _, s := range svcs {
+			out = append(out, multicluster.ClusterScoped[corev1.Service]{Cluster: cluster, Value: s})
+		}
+	}
+	return out, nil
+}
+
+// ListEndpointsInMeshAll returns the Endpoints in the mesh across the
+// primary cluster (client c) and every remote cluster known to mc, each
+// wrapped in a multicluster.ClusterScoped tagging its origin cluster.
+func ListEndpointsInMeshAll(c kubernetes.Interface, mc *multicluster.Controller) ([]multicluster.ClusterScoped[corev1.Endpoints], error) {
+	out := []multicluster.ClusterScoped[corev1.Endpoints]{}
+	eps, err := ListEndpointsInMesh(c, nil, schema.GroupVersionResource{})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range eps {
+		out = append(out, multicluster.ClusterScoped[corev1.Endpoints]{Cluster: multicluster.PrimaryCluster, Value: e})
+	}
+	for cluster, client := range mc.Clusters() {
+		eps, err := ListEndpointsInMesh(client, nil, schema.GroupVersionResource{})
+		if err != nil {
+			scopeMesh.WithFields(log.Fields{"cluster": cluster}).Errorf("Failed to list endpoints: %s", err)
+			continue
+		}
+		for _, e := range eps {
+			out = append(out, multicluster.ClusterScoped[corev1.Endpoints]{Cluster: cluster, Value: e})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,126 @@
+/*
+Portions Copyright 2018 Istio Authors
+Portions Copyright 2018 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/aspenmesh/istio-vet/pkg/multicluster"
+)
+
+// brokenRemoteKubeconfig points at a server that will never answer, so
+// every call made with the resulting client fails. multicluster.Controller
+// always builds a real kubernetes.Interface from a cluster Secret's
+// kubeconfig, so this is the only way available from this package to
+// exercise a remote cluster that errors out.
+const brokenRemoteKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: remote-a
+  cluster:
+    server: https://remote-a.invalid:16443
+contexts:
+- name: remote-a
+  context:
+    cluster: remote-a
+users: []
+current-context: remote-a
+`
+
+func remoteClusterSecret(cluster string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster,
+			Namespace: multicluster.ClusterSecretNamespace,
+			Labels:    map[string]string{multicluster.ClusterSecretLabel: "true"},
+		},
+		Data: map[string][]byte{cluster: []byte(brokenRemoteKubeconfig)},
+	}
+}
+
+func newSyncedController(t *testing.T, secrets ...*corev1.Secret) (*multicluster.Controller, func()) {
+	t.Helper()
+
+	objs := make([]runtime.Object, len(secrets))
+	for i, s := range secrets {
+		objs[i] = s
+	}
+	client := kubefake.NewSimpleClientset(objs...)
+
+	c := multicluster.NewController(client)
+	stopCh := make(chan struct{})
+	go c.Run(stopCh)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if c.HasSynced() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return c, func() { close(stopCh) }
+}
+
+// TestListNamespacesInMeshAllTagsAndContinuesPastRemoteError exercises the
+// aggregation behavior of ListNamespacesInMeshAll (and, by the same code
+// shape, ListPodsInMeshAll/ListServicesInMeshAll/ListEndpointsInMeshAll):
+// primary-cluster results are tagged with multicluster.PrimaryCluster, and
+// a remote cluster that fails to respond does not abort the whole call.
+func TestListNamespacesInMeshAllTagsAndContinuesPastRemoteError(t *testing.T) {
+	primary := kubefake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: IstioInitializerConfigMap, Namespace: IstioNamespace},
+			Data:       map[string]string{IstioInitializerConfigMapKey: "policy: enabled"},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+	)
+
+	mc, stop := newSyncedController(t, remoteClusterSecret("remote-a"))
+	defer stop()
+
+	if _, ok := mc.Clusters()["remote-a"]; !ok {
+		t.Fatal("test setup: Controller did not discover \"remote-a\"")
+	}
+
+	out, err := ListNamespacesInMeshAll(primary, mc)
+	if err != nil {
+		t.Fatalf("ListNamespacesInMeshAll() error = %s, want the remote cluster's error to be swallowed, not propagated", err)
+	}
+
+	var sawPrimary bool
+	for _, ns := range out {
+		if ns.Cluster != multicluster.PrimaryCluster {
+			t.Errorf("ListNamespacesInMeshAll() returned an entry tagged %q, want only %q since \"remote-a\" is unreachable", ns.Cluster, multicluster.PrimaryCluster)
+			continue
+		}
+		if ns.Value.Name == "default" {
+			sawPrimary = true
+		}
+	}
+	if !sawPrimary {
+		t.Errorf("ListNamespacesInMeshAll() = %v, want it to include the primary cluster's \"default\" namespace", out)
+	}
+}
@@ -25,18 +25,31 @@ import (
 
 	"github.com/cnf/structhash"
 	"github.com/ghodss/yaml"
-	"github.com/golang/glog"
 	proxyconfig "istio.io/api/proxy/v1/config"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 
 	apiv1 "github.com/aspenmesh/istio-vet/api/v1"
+	"github.com/aspenmesh/istio-vet/pkg/log"
 )
 
+var scope = log.RegisterScope("util")
+
+// ErrInjectionDisabled is the sentinel error returned by GetInitializerConfig
+// and GetInjectionConfig when no sidecar injection mechanism -- neither the
+// Istio Initializer configmap nor a sidecar-injector
+// MutatingWebhookConfiguration -- is configured in the cluster.
+var ErrInjectionDisabled = errors.New("automatic sidecar injection is not configured")
+
 const (
 	IstioNamespace                = "istio-system"
 	IstioProxyContainerName       = "istio-proxy"
+	IstioInitContainerName        = "istio-init"
+	IstioValidationContainerName  = "istio-validation"
 	IstioMixerDeploymentName      = "istio-mixer"
 	IstioMixerContainerName       = "mixer"
 	IstioPilotDeploymentName      = "istio-pilot"
@@ -49,10 +62,9 @@ const (
 	IstioInitializerConfigMapKey  = "config"
 	IstioAppLabel                 = "app"
 	ServiceProtocolUDP            = "UDP"
-	initializer_disabled          = "configmaps \"" +
-		IstioInitializerConfigMap + "\" not found"
-	initializer_disabled_summary = "Istio initializer is not configured." +
-		" Enable initializer and automatic sidecar injection to use "
+	injection_disabled_summary    = "Istio sidecar injection is not configured." +
+		" Enable the sidecar injector webhook (or the initializer) and automatic" +
+		" sidecar injection to use "
 	kubernetesServiceName = "kubernetes"
 )
 
@@ -129,35 +141,41 @@ func ExemptedNamespace(ns string) bool {
 
 // GetInitializerConfig retrieves the Istio Initializer config.
 // Istio Initializer config is stored as "istio-inject" configmap in
-// "istio-system" Namespace.
+// "istio-system" Namespace. Returns ErrInjectionDisabled if the configmap
+// does not exist.
 func GetInitializerConfig(c kubernetes.Interface) (*IstioInjectConfig, error) {
 	cm, err :=
 		c.CoreV1().ConfigMaps(IstioNamespace).Get(IstioInitializerConfigMap, metav1.GetOptions{})
 	if err != nil {
-		glog.V(2).Infof("Failed to retrieve configmap: %s error: %s", IstioInitializerConfigMap, err)
+		if apierrors.IsNotFound(err) {
+			scope.Debugf("Initializer configmap: %s not found in namespace: %s", IstioInitializerConfigMap, IstioNamespace)
+			return nil, ErrInjectionDisabled
+		}
+		scope.Errorf("Failed to retrieve configmap: %s error: %s", IstioInitializerConfigMap, err)
 		return nil, err
 	}
 	d, e := cm.Data[IstioInitializerConfigMapKey]
 	if !e {
-		errStr := fmt.Sprintf("Missing configuration map key: %s in configmap: %s", IstioInitializerConfigMapKey, IstioInitializerConfigMap)
-		glog.Errorf(errStr)
-		return nil, errors.New(errStr)
+		scope.Errorf("Missing configuration map key: %s in configmap: %s", IstioInitializerConfigMapKey, IstioInitializerConfigMap)
+		return nil, fmt.Errorf("missing configuration map key: %s in configmap: %s", IstioInitializerConfigMapKey, IstioInitializerConfigMap)
 	}
 	var cfg IstioInjectConfig
 	if err := yaml.Unmarshal([]byte(d), &cfg); err != nil {
-		glog.Errorf("Failed to parse yaml initializer config: %s", err)
+		scope.Errorf("Failed to parse yaml initializer config: %s", err)
 		return nil, err
 	}
 	return &cfg, nil
 }
 
-// IstioInitializerDisabledNote generates an INFO note if the error string
-// contains "istio-inject configmap not found".
-func IstioInitializerDisabledNote(e, vetterId, vetterType string) *apiv1.Note {
-	if strings.Contains(e, initializer_disabled) {
+// InjectionDisabledNote generates an INFO note if err is ErrInjectionDisabled,
+// i.e. no sidecar injection mechanism is configured in the cluster, whether
+// because the Istio Initializer configmap is missing or no
+// "istio-sidecar-injector" MutatingWebhookConfiguration is registered.
+func InjectionDisabledNote(err error, vetterId, vetterType string) *apiv1.Note {
+	if err == ErrInjectionDisabled {
 		return &apiv1.Note{
 			Type:    vetterType,
-			Summary: initializer_disabled_summary + "\"" + vetterId + "\" vetter.",
+			Summary: injection_disabled_summary + "\"" + vetterId + "\" vetter.",
 			Level:   apiv1.NoteLevel_INFO}
 	}
 	return nil
@@ -176,40 +194,88 @@ func ServicePortPrefixed(n string) bool {
 	return false
 }
 
+// InjectionMode enumerates how (if at all) the Istio sidecar was injected
+// into a Pod.
+type InjectionMode int
+
+const (
+	// InjectionModeNone indicates no Istio sidecar is present.
+	InjectionModeNone InjectionMode = iota
+	// InjectionModeInitContainer indicates the sidecar's iptables
+	// redirection was set up in-Pod by the "istio-init" init container.
+	InjectionModeInitContainer
+	// InjectionModeCNI indicates the Istio CNI plugin set up iptables
+	// redirection outside the Pod, leaving only the lightweight
+	// "istio-validation" init container behind.
+	InjectionModeCNI
+	// InjectionModeUnknown indicates the "istio-proxy" container is
+	// present, but neither a recognized "istio-init" nor
+	// "istio-validation" init container was found, so which injection
+	// topology was used could not be determined.
+	InjectionModeUnknown
+)
+
+// SidecarInjectionMode inspects p's containers and init containers to
+// determine how (if at all) the Istio sidecar was injected. Among Pods
+// carrying the "istio-proxy" container, the first "istio-validation" or
+// "istio-init" init container found decides the result:
+// "istio-validation" reports InjectionModeCNI and "istio-init" reports
+// InjectionModeInitContainer. A Pod with neither reports
+// InjectionModeUnknown.
+func SidecarInjectionMode(p corev1.Pod) InjectionMode {
+	hasProxy := false
+	for _, c := range p.Spec.Containers {
+		if c.Name == IstioProxyContainerName {
+			hasProxy = true
+			break
+		}
+	}
+	if !hasProxy {
+		return InjectionModeNone
+	}
+	for _, c := range p.Spec.InitContainers {
+		switch c.Name {
+		case IstioValidationContainerName:
+			return InjectionModeCNI
+		case IstioInitContainerName:
+			return InjectionModeInitContainer
+		}
+	}
+	return InjectionModeUnknown
+}
+
 // SidecarInjected checks if sidecar is injected in a Pod.
-// Sidecar is considered injected if initializer annotation and proxy container
-// are both present in the Pod Spec.
+// Sidecar is considered injected if initializer annotation is present and
+// SidecarInjectionMode reports any mode other than InjectionModeNone, i.e.
+// the "istio-proxy" container is present; InjectionModeUnknown (no
+// recognized init container) also counts as injected.
 func SidecarInjected(p corev1.Pod) bool {
 	if _, ok := p.Annotations[IstioInitializerPodAnnotation]; !ok {
 		return false
 	}
-	cList := p.Spec.Containers
-	for _, c := range cList {
-		if c.Name == IstioProxyContainerName {
-			return true
-		}
-	}
-	return false
+	return SidecarInjectionMode(p) != InjectionModeNone
 }
 
-// ImageTag returns the Image tag of a named Container if present in the Pod Spec.
+// ImageTag returns the Image tag of a named Container if present among the
+// Pod Spec's Containers or InitContainers (e.g. "istio-proxy",
+// "istio-init" or "istio-validation").
 // If no version is specified "latest" is returned.
 // Returns error if Container is not present in the Pod Spec.
 func ImageTag(n string, s corev1.PodSpec) (string, error) {
-	cList := s.Containers
-	for _, c := range cList {
-		if c.Name == n {
-			imageTags := strings.Split(c.Image, ":")
-			if len(imageTags) == 1 {
-				return "latest", nil
-			} else {
-				return imageTags[len(imageTags)-1], nil
+	for _, cList := range [][]corev1.Container{s.Containers, s.InitContainers} {
+		for _, c := range cList {
+			if c.Name == n {
+				imageTags := strings.Split(c.Image, ":")
+				if len(imageTags) == 1 {
+					return "latest", nil
+				} else {
+					return imageTags[len(imageTags)-1], nil
+				}
 			}
 		}
 	}
-	errStr := fmt.Sprintf("Failed to find container: %s", n)
-	glog.Error(errStr)
-	return "", errors.New(errStr)
+	scope.Errorf("Failed to find container: %s", n)
+	return "", fmt.Errorf("failed to find container: %s", n)
 }
 
 func existsInStringSlice(e string, list []string) bool {
@@ -221,37 +287,45 @@ func existsInStringSlice(e string, list []string) bool {
 	return false
 }
 
-// ListNamespacesInMesh returns the list of Namespaces in the mesh.
-// Inspects the Istio Initializer(istio-inject) configmap to enumerate
-// Namespaces included/excluded from the mesh.
-func ListNamespacesInMesh(c kubernetes.Interface) ([]corev1.Namespace, error) {
+// ListNamespacesInMesh returns the list of Namespaces in the mesh. The
+// active InjectionSource (auto-detected by GetInjectionConfig) is
+// consulted to decide which Namespaces are subject to automatic sidecar
+// injection. If dc is non-nil, a Namespace that is otherwise
+// exempted/excluded but hosts at least one ServiceImport custom resource
+// (of GroupVersionResource importGVR) is also included -- such a
+// Namespace hosts only Services federated in from a remote mesh, but
+// still needs to be considered "in mesh" for vetters that check hostname
+// collisions across federated meshes. Callers not using federation can
+// pass a nil dc, in which case importGVR is ignored.
+func ListNamespacesInMesh(c kubernetes.Interface, dc dynamic.Interface, importGVR schema.GroupVersionResource) ([]corev1.Namespace, error) {
 	opts := metav1.ListOptions{}
 	namespaces := []corev1.Namespace{}
 	ns, err := c.CoreV1().Namespaces().List(opts)
 	if err != nil {
-		glog.Error("Failed to retrieve namespaces: ", err)
+		scope.Errorf("Failed to retrieve namespaces: %s", err)
 		return nil, err
 	}
-	cfg, err := GetInitializerConfig(c)
+	src, err := GetInjectionConfig(c)
 	if err != nil {
 		return nil, err
 	}
+	inMesh := make(map[string]bool, len(ns.Items))
 	for _, n := range ns.Items {
-		if ExemptedNamespace(n.Name) == true {
-			continue
+		if src.NamespaceInjected(n) {
+			namespaces = append(namespaces, n)
+			inMesh[n.Name] = true
 		}
-		if cfg.ExcludeNamespaces != nil && len(cfg.ExcludeNamespaces) > 0 {
-			excluded := existsInStringSlice(n.Name, cfg.ExcludeNamespaces)
-			if excluded == true {
-				continue
-			}
+	}
+	if dc == nil {
+		return namespaces, nil
+	}
+	for _, n := range ns.Items {
+		if inMesh[n.Name] {
+			continue
 		}
-		if cfg.IncludeNamespaces != nil && len(cfg.IncludeNamespaces) > 0 {
-			included := existsInStringSlice(corev1.NamespaceAll, cfg.IncludeNamespaces) ||
-				existsInStringSlice(n.Name, cfg.IncludeNamespaces)
-			if included == false {
-				continue
-			}
+		list, err := dc.Resource(importGVR).Namespace(n.Name).List(metav1.ListOptions{})
+		if err != nil || len(list.Items) == 0 {
+			continue
 		}
 		namespaces = append(namespaces, n)
 	}
@@ -259,23 +333,36 @@ func ListNamespacesInMesh(c kubernetes.Interface) ([]corev1.Namespace, error) {
 }
 
 // ListPodsInMesh returns the list of Pods in the mesh.
-// Pods in Namespaces returned by ListNamespacesInMesh with sidecar
-// injected as determined by SidecarInjected are considered in the mesh.
+// Unlike ListNamespacesInMesh, this does not filter Namespaces by
+// InjectionSource.NamespaceInjected up front: a Pod carrying an explicit
+// sidecar.istio.io/inject override can be in the mesh even if its
+// Namespace's namespaceSelector does not match, so every non-exempted
+// Namespace's Pods are evaluated individually via
+// InjectionSource.PodInjected.
 func ListPodsInMesh(c kubernetes.Interface) ([]corev1.Pod, error) {
 	opts := metav1.ListOptions{}
 	pods := []corev1.Pod{}
-	ns, err := ListNamespacesInMesh(c)
+	ns, err := c.CoreV1().Namespaces().List(opts)
 	if err != nil {
+		scope.Errorf("Failed to retrieve namespaces: %s", err)
 		return nil, err
 	}
-	for _, n := range ns {
+	src, err := GetInjectionConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range ns.Items {
+		if ExemptedNamespace(n.Name) {
+			continue
+		}
+		nsInjected := src.NamespaceInjected(n)
 		podList, err := c.CoreV1().Pods(n.Name).List(opts)
 		if err != nil {
-			glog.Errorf("Failed to retrieve pods for namespace: %s error: %s", n.Name, err)
+			scope.WithFields(log.Fields{"namespace": n.Name}).Errorf("Failed to retrieve pods: %s", err)
 			return nil, err
 		}
 		for _, p := range podList.Items {
-			if SidecarInjected(p) == true {
+			if src.PodInjected(p, nsInjected) {
 				pods = append(pods, p)
 			}
 		}
@@ -283,19 +370,25 @@ func ListPodsInMesh(c kubernetes.Interface) ([]corev1.Pod, error) {
 	return pods, nil
 }
 
-// ListServicesInMesh returns the list of Services in the mesh.
-// Services in Namespaces returned by ListNamespacesInMesh are considered in the mesh.
-func ListServicesInMesh(c kubernetes.Interface) ([]corev1.Service, error) {
+// ListServicesInMesh returns the list of Services in the mesh. Services
+// in Namespaces returned by ListNamespacesInMesh are considered in the
+// mesh. If dc is non-nil, the result is extended with every Service
+// imported from a FederationPeer via a ServiceImport custom resource (of
+// GroupVersionResource importGVR), so vetters checking for hostname
+// collisions also account for Services federated in from other meshes.
+// Callers not using federation can pass a nil dc, in which case importGVR
+// is ignored.
+func ListServicesInMesh(c kubernetes.Interface, dc dynamic.Interface, importGVR schema.GroupVersionResource) ([]corev1.Service, error) {
 	opts := metav1.ListOptions{}
 	services := []corev1.Service{}
-	ns, err := ListNamespacesInMesh(c)
+	ns, err := ListNamespacesInMesh(c, dc, importGVR)
 	if err != nil {
 		return nil, err
 	}
 	for _, n := range ns {
 		serviceList, err := c.CoreV1().Services(n.Name).List(opts)
 		if err != nil {
-			glog.Errorf("Failed to retrieve services for namespace: %s error: %s", n.Name, err)
+			scope.WithFields(log.Fields{"namespace": n.Name}).Errorf("Failed to retrieve services: %s", err)
 			return nil, err
 		}
 		for _, s := range serviceList.Items {
@@ -304,22 +397,31 @@ func ListServicesInMesh(c kubernetes.Interface) ([]corev1.Service, error) {
 			}
 		}
 	}
-	return services, nil
+	if dc == nil {
+		return services, nil
+	}
+	imported, err := ListImportedServicesInMesh(dc, c, importGVR)
+	if err != nil {
+		return nil, err
+	}
+	return append(services, imported...), nil
 }
 
 // ListEndpointsInMesh returns the list of Endpoints in the mesh.
-// Endpoints in Namespaces returned by ListNamespacesInMesh are considered in the mesh.
-func ListEndpointsInMesh(c kubernetes.Interface) ([]corev1.Endpoints, error) {
+// Endpoints in Namespaces returned by ListNamespacesInMesh are considered
+// in the mesh. Callers not using federation can pass a nil dc, in which
+// case importGVR is ignored.
+func ListEndpointsInMesh(c kubernetes.Interface, dc dynamic.Interface, importGVR schema.GroupVersionResource) ([]corev1.Endpoints, error) {
 	opts := metav1.ListOptions{}
 	endpoints := []corev1.Endpoints{}
-	ns, err := ListNamespacesInMesh(c)
+	ns, err := ListNamespacesInMesh(c, dc, importGVR)
 	if err != nil {
 		return nil, err
 	}
 	for _, n := range ns {
 		endpointList, err := c.CoreV1().Endpoints(n.Name).List(opts)
 		if err != nil {
-			glog.Errorf("Failed to retrieve endpoints for namespace: %s error: %s", n.Name, err)
+			scope.WithFields(log.Fields{"namespace": n.Name}).Errorf("Failed to retrieve endpoints: %s", err)
 			return nil, err
 		}
 		for _, s := range endpointList.Items {
@@ -331,8 +433,18 @@ func ListEndpointsInMesh(c kubernetes.Interface) ([]corev1.Endpoints, error) {
 	return endpoints, nil
 }
 
-// ComputeId returns MD5 checksum of the Note struct which can be used as
-// ID for the note.
-func ComputeId(n *apiv1.Note) string {
-	return fmt.Sprintf("%x", structhash.Md5(n, 1))
+// ComputeId returns the MD5 checksum of the Note struct, optionally scoped
+// to a cluster identifier, which can be used as the ID for the note.
+// cluster should be the empty string for the primary cluster, or a remote
+// cluster name (see multicluster.Controller) so that notes describing
+// otherwise-identical issues remain unique across the clusters of a
+// multi-cluster mesh.
+func ComputeId(cluster string, n *apiv1.Note) string {
+	if cluster == "" {
+		return fmt.Sprintf("%x", structhash.Md5(n, 1))
+	}
+	return fmt.Sprintf("%x", structhash.Md5(struct {
+		Cluster string
+		Note    *apiv1.Note
+	}{cluster, n}, 1))
 }
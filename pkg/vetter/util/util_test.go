@@ -0,0 +1,89 @@
+/*
+Portions Copyright 2017 Istio Authors
+Portions Copyright 2017 Aspen Mesh Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	apiv1 "github.com/aspenmesh/istio-vet/api/v1"
+)
+
+func podWithContainers(containerNames, initContainerNames []string) corev1.Pod {
+	p := corev1.Pod{}
+	for _, n := range containerNames {
+		p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Name: n})
+	}
+	for _, n := range initContainerNames {
+		p.Spec.InitContainers = append(p.Spec.InitContainers, corev1.Container{Name: n})
+	}
+	return p
+}
+
+func TestSidecarInjectionMode(t *testing.T) {
+	cases := []struct {
+		name string
+		pod  corev1.Pod
+		want InjectionMode
+	}{
+		{"no proxy container", podWithContainers(nil, []string{IstioInitContainerName}), InjectionModeNone},
+		{"proxy with istio-init", podWithContainers([]string{IstioProxyContainerName}, []string{IstioInitContainerName}), InjectionModeInitContainer},
+		{"proxy with istio-validation", podWithContainers([]string{IstioProxyContainerName}, []string{IstioValidationContainerName}), InjectionModeCNI},
+		{"proxy with no recognized init container", podWithContainers([]string{IstioProxyContainerName}, []string{"some-other-init"}), InjectionModeUnknown},
+		{"proxy with no init containers at all", podWithContainers([]string{IstioProxyContainerName}, nil), InjectionModeUnknown},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SidecarInjectionMode(tc.pod); got != tc.want {
+				t.Errorf("SidecarInjectionMode(%s) = %v, want %v", tc.name, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	spec := corev1.PodSpec{
+		Containers:     []corev1.Container{{Name: IstioProxyContainerName, Image: "docker.io/istio/proxy:1.0.0"}},
+		InitContainers: []corev1.Container{{Name: IstioInitContainerName, Image: "docker.io/istio/init"}},
+	}
+
+	if got, err := ImageTag(IstioProxyContainerName, spec); err != nil || got != "1.0.0" {
+		t.Errorf("ImageTag(%s) = %q, %v, want \"1.0.0\", nil", IstioProxyContainerName, got, err)
+	}
+	if got, err := ImageTag(IstioInitContainerName, spec); err != nil || got != "latest" {
+		t.Errorf("ImageTag(%s) = %q, %v, want \"latest\", nil", IstioInitContainerName, got, err)
+	}
+	if _, err := ImageTag("missing", spec); err == nil {
+		t.Error("ImageTag(\"missing\") = nil error, want an error")
+	}
+}
+
+func TestComputeId(t *testing.T) {
+	n := &apiv1.Note{Type: "test", Summary: "a summary"}
+
+	if ComputeId("", n) != ComputeId("", n) {
+		t.Error("ComputeId(\"\", n) is not stable across calls with an identical Note")
+	}
+	if ComputeId("", n) == ComputeId("cluster-a", n) {
+		t.Error("ComputeId(\"\", n) == ComputeId(\"cluster-a\", n), want the cluster identifier to change the ID")
+	}
+	if ComputeId("cluster-a", n) == ComputeId("cluster-b", n) {
+		t.Error("ComputeId(\"cluster-a\", n) == ComputeId(\"cluster-b\", n), want distinct clusters to produce distinct IDs")
+	}
+}